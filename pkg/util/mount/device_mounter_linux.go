@@ -0,0 +1,135 @@
+// +build linux
+
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// deviceMounter is the Linux implementation of DeviceMounter. It stages
+// devices under <pluginDir>/mounts/<name> and delegates the actual
+// format-and-mount work to a SafeFormatAndMount, so volume plugins that
+// need a global staging mount don't have to reimplement device-path
+// resolution or idempotency checks.
+type deviceMounter struct {
+	*SafeFormatAndMount
+	pluginDir string
+}
+
+// NewDeviceMounter returns a DeviceMounter backed by formatter that stages
+// devices under <pluginDir>/mounts/<name>.
+func NewDeviceMounter(formatter *SafeFormatAndMount, pluginDir string) DeviceMounter {
+	return &deviceMounter{
+		SafeFormatAndMount: formatter,
+		pluginDir:          pluginDir,
+	}
+}
+
+// GetDeviceMountPath implements DeviceMounter.GetDeviceMountPath.
+func (dm *deviceMounter) GetDeviceMountPath(spec *DeviceMountSpec) (string, error) {
+	if spec.Name == "" {
+		return "", fmt.Errorf("cannot determine device mount path: spec has no Name")
+	}
+	return filepath.Join(dm.pluginDir, MountsInGlobalPDPath, spec.Name), nil
+}
+
+// MountDevice implements DeviceMounter.MountDevice. It resolves devicePath
+// through /dev/disk/by-id (or any other) symlinks, skips the operation
+// entirely if devicePath is already staged at globalPath, formats and
+// mounts filesystem volumes via SafeFormatAndMount, and mounts raw-block
+// volumes (fstype == "") directly without fsck/mkfs.
+func (dm *deviceMounter) MountDevice(devicePath, globalPath, fstype string, opts []string) error {
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve device path %q: %v", devicePath, err)
+	}
+
+	staged, err := dm.deviceStagedAt(resolved, globalPath)
+	if err != nil {
+		return err
+	}
+	if staged {
+		glog.V(4).Infof("Device %s is already mounted at %s, skipping mount", resolved, globalPath)
+		return nil
+	}
+
+	if err := dm.MakeDir(globalPath); err != nil {
+		return fmt.Errorf("failed to create device mount path %q: %v", globalPath, err)
+	}
+
+	if fstype == "" {
+		// Raw block volume: mount the device itself, no fsck/mkfs.
+		return dm.Interface.Mount(resolved, globalPath, fstype, opts)
+	}
+	return dm.FormatAndMount(resolved, globalPath, fstype, opts)
+}
+
+// UnmountDevice implements DeviceMounter.UnmountDevice.
+func (dm *deviceMounter) UnmountDevice(globalPath string) error {
+	notMnt, err := dm.IsLikelyNotMountPoint(globalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !notMnt {
+		if err := dm.Unmount(globalPath); err != nil {
+			return fmt.Errorf("failed to unmount device mount path %q: %v", globalPath, err)
+		}
+	}
+
+	// Only remove globalPath if it is left empty; a non-empty directory
+	// means another volume (or the user) still has something there.
+	if err := os.Remove(globalPath); err != nil && !os.IsNotExist(err) {
+		if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.ENOTEMPTY {
+			return nil
+		}
+		return fmt.Errorf("failed to remove device mount path %q: %v", globalPath, err)
+	}
+	return nil
+}
+
+// deviceStagedAt reports whether devicePath is already mounted at
+// globalPath, by consulting /proc/self/mountinfo rather than /proc/mounts
+// so that MountDevice stays idempotent even across bind mounts.
+func (dm *deviceMounter) deviceStagedAt(devicePath, globalPath string) (bool, error) {
+	info, err := GetMountInfo(globalPath)
+	if err != nil {
+		return false, nil
+	}
+	resolvedSource, err := filepath.EvalSymlinks(info.Source)
+	if err != nil {
+		resolvedSource = info.Source
+	}
+	return deviceMatchesResolvedSource(devicePath, resolvedSource), nil
+}
+
+// deviceMatchesResolvedSource reports whether devicePath (already resolved
+// through symlinks by the caller) is the same device as resolvedSource (a
+// mount's Source field, similarly resolved), split out of deviceStagedAt so
+// the matching itself is testable without a real mountinfo or filesystem.
+func deviceMatchesResolvedSource(devicePath, resolvedSource string) bool {
+	return resolvedSource == devicePath
+}
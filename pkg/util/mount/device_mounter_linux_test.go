@@ -0,0 +1,95 @@
+// +build linux
+
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGetDeviceMountPath(t *testing.T) {
+	dm := &deviceMounter{pluginDir: "/var/lib/kubelet/plugins/example"}
+
+	tests := []struct {
+		name      string
+		spec      *DeviceMountSpec
+		want      string
+		wantError bool
+	}{
+		{
+			name: "named volume",
+			spec: &DeviceMountSpec{Name: "pvc-1234"},
+			want: filepath.Join("/var/lib/kubelet/plugins/example", MountsInGlobalPDPath, "pvc-1234"),
+		},
+		{
+			name:      "empty name",
+			spec:      &DeviceMountSpec{},
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := dm.GetDeviceMountPath(test.spec)
+			if test.wantError {
+				if err == nil {
+					t.Fatalf("GetDeviceMountPath(%+v) expected an error, got none", test.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDeviceMountPath(%+v) unexpected error: %v", test.spec, err)
+			}
+			if got != test.want {
+				t.Errorf("GetDeviceMountPath(%+v) = %q, want %q", test.spec, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDeviceMatchesResolvedSource(t *testing.T) {
+	tests := []struct {
+		name           string
+		devicePath     string
+		resolvedSource string
+		want           bool
+	}{
+		{
+			name:           "same resolved device",
+			devicePath:     "/dev/sdb",
+			resolvedSource: "/dev/sdb",
+			want:           true,
+		},
+		{
+			name:           "different device",
+			devicePath:     "/dev/sdb",
+			resolvedSource: "/dev/sdc",
+			want:           false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := deviceMatchesResolvedSource(test.devicePath, test.resolvedSource)
+			if got != test.want {
+				t.Errorf("deviceMatchesResolvedSource(%q, %q) = %v, want %v", test.devicePath, test.resolvedSource, got, test.want)
+			}
+		})
+	}
+}
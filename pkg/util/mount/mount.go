@@ -0,0 +1,228 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mount defines an interface to mounting filesystems.
+package mount
+
+import (
+	"path/filepath"
+
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// MountsInGlobalPDPath is the name of the subdirectory under the plugin
+	// directory where global mounts for attachable volumes are created.
+	MountsInGlobalPDPath = "mounts"
+)
+
+// Interface defines the set of methods to allow for mount operations on a system.
+type Interface interface {
+	// Mount mounts source to target as fstype with given options.
+	Mount(source string, target string, fstype string, options []string) error
+	// Unmount unmounts given target.
+	Unmount(target string) error
+	// List returns a list of all mounted filesystems.  This can be large.
+	// On some platforms, reading mounts directly from the OS is not guaranteed
+	// consistent (i.e. it could change between chunked reads). This is guaranteed
+	// to be consistent.
+	List() ([]MountPoint, error)
+	// IsLikelyNotMountPoint uses heuristics to determine if a directory
+	// is not a mountpoint.
+	// It should return ErrNotExist when the directory does not exist.
+	// IsLikelyNotMountPoint does NOT properly detect all mountpoint types
+	// most notably linux bind mounts and symbolic link. For callers that do not
+	// care about such situations, this is a faster alternative to calling List()
+	// and scanning that output.
+	IsLikelyNotMountPoint(file string) (bool, error)
+	// DeviceOpened determines if the device (e.g. /dev/sdc) is in use elsewhere
+	// on the system, i.e. still mounted.
+	DeviceOpened(pathname string) (bool, error)
+	// PathIsDevice determines if a path is a device.
+	PathIsDevice(pathname string) (bool, error)
+	// GetDeviceNameFromMount finds the device name by checking the mount path
+	// to get the global mount path which matches its plugin directory.
+	GetDeviceNameFromMount(mountPath, pluginMountDir string) (string, error)
+	// MakeRShared checks that given path is on a mount with 'rshared' mount
+	// propagation. If not, it bind-mounts the path as rshared.
+	MakeRShared(path string) error
+	// GetFileType checks for file/directory/socket/block/character devices.
+	GetFileType(pathname string) (FileType, error)
+	// MakeDir creates a new directory.
+	MakeDir(pathname string) error
+	// MakeFile creates an empty file.
+	MakeFile(pathname string) error
+	// ExistsPath checks whether the path exists.
+	ExistsPath(pathname string) bool
+	// IsMountPointMatch tests if dir and mp are the same path.
+	IsMountPointMatch(mp MountPoint, dir string) bool
+}
+
+// DeviceMounter defines the set of methods to stage (and unstage) an
+// attachable block device at a single global mount path before it is
+// bind-mounted into individual pods. Implementations must make MountDevice
+// and UnmountDevice idempotent, since the operation_generator retries them
+// freely.
+type DeviceMounter interface {
+	// GetDeviceMountPath returns the global path where devicePath should be
+	// staged for the given spec, e.g. <plugin dir>/mounts/<volume name>.
+	GetDeviceMountPath(spec *DeviceMountSpec) (string, error)
+	// MountDevice stages devicePath at globalPath, formatting it with fstype
+	// first if it is unformatted and fstype is a filesystem (as opposed to a
+	// raw block volume, signalled by an empty fstype). It is a no-op if
+	// devicePath is already mounted at globalPath.
+	MountDevice(devicePath, globalPath, fstype string, opts []string) error
+	// UnmountDevice unstages the device mounted at globalPath and removes
+	// globalPath if it is left empty.
+	UnmountDevice(globalPath string) error
+}
+
+// BindOptions controls how BindMount binds source onto target, so callers
+// don't have to hand-craft the "bind, then remount" two-step themselves.
+type BindOptions struct {
+	// Recursive turns the bind into an rbind, so mounts under source are
+	// bound too.
+	Recursive bool
+	// ReadOnly remounts the bind read-only after the initial bind, and has
+	// BindMount verify the remount actually took effect.
+	ReadOnly bool
+	// Propagation sets the mount's shared-subtree propagation, e.g.
+	// "private", "shared", or "slave". Left untouched when empty.
+	Propagation string
+}
+
+// DeviceMountSpec carries the information DeviceMounter needs about a
+// volume in order to stage its device. Fstype and mount options are passed
+// separately to MountDevice, since they can differ between the format step
+// and the mount step in a way a single spec can't capture.
+type DeviceMountSpec struct {
+	// Name is used to namespace the device's global mount path, e.g.
+	// <plugin dir>/mounts/<Name>.
+	Name string
+}
+
+// MountPoint represents a single line in /proc/mounts or /etc/fstab.
+type MountPoint struct {
+	Device string
+	Path   string
+	Type   string
+	Opts   []string
+	Freq   int
+	Pass   int
+}
+
+// FileType denotes the type of file this is, e.g. directory, socket, block/char device.
+type FileType string
+
+const (
+	// FileTypeBlockDev defines the constant for the block device FileType.
+	FileTypeBlockDev FileType = "BlockDevice"
+	// FileTypeCharDev defines the constant for the character device FileType.
+	FileTypeCharDev FileType = "CharDevice"
+	// FileTypeDirectory defines the constant for the directory FileType.
+	FileTypeDirectory FileType = "Directory"
+	// FileTypeFile defines the constant for the file FileType.
+	FileTypeFile FileType = "File"
+	// FileTypeSocket defines the constant for the socket FileType.
+	FileTypeSocket FileType = "Socket"
+)
+
+// SafeFormatAndMount probes a device to see if it is formatted. If not it
+// formats it with the given filesystem (and FormatOptions, if any), then
+// mounts it.
+type SafeFormatAndMount struct {
+	Interface
+	Exec utilexec.Interface
+	// FormatOptions are extra flags passed to mkfs when a device needs to be
+	// formatted, e.g. []string{"-K"} to skip mkfs.xfs's discard, or
+	// []string{"-b", "size=4096"}.
+	FormatOptions []string
+}
+
+// FormatAndMount formats the given disk, if needed, and mounts it. That is
+// if the disk is not formatted and it is not being mounted as read-only it
+// will format it first then mount it. Otherwise, if the disk is already
+// formatted or it is being mounted as read-only, it will be mounted without
+// formatting.
+func (mounter *SafeFormatAndMount) FormatAndMount(source string, target string, fstype string, options []string) error {
+	return mounter.formatAndMount(source, target, fstype, options)
+}
+
+// defaultMountCommand is the default mount command to use when mounting
+// directly (i.e. no containerized mounter is needed for this filesystem).
+const defaultMountCommand = "mount"
+
+// isBind detects whether a bind mount is being requested and returns the
+// list of options to use in the subsequent remount that applies everything
+// else (e.g. "ro").
+func isBind(options []string) (bool, []string) {
+	bindRemountOpts := []string{"remount"}
+	bind := false
+
+	if len(options) != 0 {
+		for _, option := range options {
+			switch option {
+			case "bind":
+				bind = true
+				break
+			case "remount":
+				break
+			default:
+				bindRemountOpts = append(bindRemountOpts, option)
+			}
+		}
+	}
+
+	return bind, bindRemountOpts
+}
+
+// bindRemountOptions returns the "remount" option list BindMount applies
+// after the initial bind, and whether a remount call is needed at all (no
+// remount is needed for a plain read-write bind with no propagation
+// change).
+func bindRemountOptions(opts BindOptions) (remountOpts []string, needed bool) {
+	remountOpts = []string{"remount"}
+	if opts.ReadOnly {
+		remountOpts = append(remountOpts, "ro")
+	}
+	if opts.Propagation != "" {
+		remountOpts = append(remountOpts, opts.Propagation)
+	}
+	return remountOpts, len(remountOpts) > 1
+}
+
+// IsNotMountPoint determines if a directory is a mountpoint, by checking
+// if the directory is equal to the Path in any MountPoint Interface List.
+// This is an expensive operation that scans through the mount list, prefer
+// mounter.IsLikelyNotMountPoint if it can satisfy your needs.
+func IsNotMountPoint(mounter Interface, file string) (bool, error) {
+	// Resolve any symlinks in file, kernel report the target path in mountinfo
+	// not the symlink.
+	resolvedFile, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		resolvedFile = file
+	}
+	mps, err := mounter.List()
+	if err != nil {
+		return true, err
+	}
+	for _, mp := range mps {
+		if mounter.IsMountPointMatch(mp, resolvedFile) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -51,6 +51,19 @@ const (
 	fsckErrorsUncorrected = 4
 )
 
+// mkfsDefaultArgs holds the arguments mkfs.<fstype> needs in order to
+// (re)format a device that may carry a stale filesystem signature, keyed by
+// fstype. Filesystems not present in this table are formatted with no
+// additional default arguments.
+var mkfsDefaultArgs = map[string][]string{
+	"ext2": {"-F"},
+	"ext3": {"-F"},
+	"ext4": {"-F"},
+	// mkfs.xfs refuses to write over an existing filesystem signature
+	// unless told to force it.
+	"xfs": {"-f"},
+}
+
 // Mounter provides the default implementation of mount.Interface
 // for the linux platform.  This implementation assumes that the
 // kubelet is running in the host's root mount namespace.
@@ -94,6 +107,60 @@ func (mounter *Mounter) Mount(source string, target string, fstype string, optio
 	return mounter.doMount(mounterPath, defaultMountCommand, source, target, fstype, options)
 }
 
+// BindMount bind-mounts source onto target, creating target as an empty
+// file or directory to match source (mirroring what Docker's bind-mount
+// handling does via fileutils.CreateIfNotExists), and applies opts. This
+// saves callers from having to hand-craft the "bind, then remount" two-step
+// that a read-only or propagation-changing bind mount requires.
+func (mounter *Mounter) BindMount(source, target string, opts BindOptions) error {
+	fileType, err := mounter.GetFileType(source)
+	if err != nil {
+		return err
+	}
+	if fileType == FileTypeDirectory {
+		if err := mounter.MakeDir(target); err != nil {
+			return err
+		}
+	} else {
+		// Everything but a directory (regular file, block/char device,
+		// socket) needs a non-directory mountpoint: bind-mounting a device
+		// node or socket onto a directory target fails in the kernel with
+		// ENOTDIR.
+		if err := mounter.MakeFile(target); err != nil {
+			return err
+		}
+	}
+
+	bindOption := "bind"
+	if opts.Recursive {
+		bindOption = "rbind"
+	}
+	if err := mounter.doMount("", defaultMountCommand, source, target, "", []string{bindOption}); err != nil {
+		return err
+	}
+
+	remountOpts, needsRemount := bindRemountOptions(opts)
+	if needsRemount {
+		if err := mounter.doMount("", defaultMountCommand, source, target, "", remountOpts); err != nil {
+			return err
+		}
+	}
+
+	if opts.ReadOnly {
+		info, err := GetMountInfo(target)
+		if err != nil {
+			return fmt.Errorf("failed to verify read-only bind mount of %s: %v", target, err)
+		}
+		for _, option := range info.MountOptions {
+			if option == "ro" {
+				return nil
+			}
+		}
+		return fmt.Errorf("failed to bind-mount %s as read-only: effective mount options are %v", target, info.MountOptions)
+	}
+	return nil
+}
+
 // doMount runs the mount command. mounterPath is the path to mounter binary if containerized mounter is used.
 func (m *Mounter) doMount(mounterPath string, mountCmd string, source string, target string, fstype string, options []string) error {
 	mountArgs := makeMountArgs(source, target, fstype, options)
@@ -146,37 +213,53 @@ func (m *Mounter) doMount(mounterPath string, mountCmd string, source string, ta
 
 // GetMountRefs finds all other references to the device referenced
 // by mountPath; returns a list of paths.
+// mounter is unused here (kept for API compatibility with existing
+// callers) because the lookup needs /proc/self/mountinfo's majorMinor, not
+// anything List() exposes.
 func GetMountRefs(mounter Interface, mountPath string) ([]string, error) {
-	mps, err := mounter.List()
+	infos, err := parseMountInfo(procMountInfoPath)
 	if err != nil {
 		return nil, err
 	}
-	// Find the device name.
-	deviceName := ""
+
 	// If mountPath is symlink, need get its target path.
 	slTarget, err := filepath.EvalSymlinks(mountPath)
 	if err != nil {
 		slTarget = mountPath
 	}
-	for i := range mps {
-		if mps[i].Path == slTarget {
-			deviceName = mps[i].Device
+
+	return getMountRefsByMountInfo(infos, mountPath, slTarget), nil
+}
+
+// getMountRefsByMountInfo finds all other MountPoints in infos that share a
+// MajorMinor with slTarget (mountPath resolved through symlinks), split out
+// of GetMountRefs so the matching logic can be tested against fixture
+// MountInfo data without reading /proc/self/mountinfo.
+func getMountRefsByMountInfo(infos []MountInfo, mountPath, slTarget string) []string {
+	// Find the device identifier. majorMinor, unlike Source/Device, is
+	// unique per mounted filesystem instance, so two unrelated mounts that
+	// happen to share a Source (e.g. tmpfs mounted at several places) are
+	// not confused with one another.
+	majorMinor := ""
+	for i := range infos {
+		if infos[i].MountPoint == slTarget {
+			majorMinor = infos[i].MajorMinor
 			break
 		}
 	}
 
 	// Find all references to the device.
 	var refs []string
-	if deviceName == "" {
+	if majorMinor == "" {
 		glog.Warningf("could not determine device for path: %q", mountPath)
 	} else {
-		for i := range mps {
-			if mps[i].Device == deviceName && mps[i].Path != slTarget {
-				refs = append(refs, mps[i].Path)
+		for i := range infos {
+			if infos[i].MajorMinor == majorMinor && infos[i].MountPoint != slTarget {
+				refs = append(refs, infos[i].MountPoint)
 			}
 		}
 	}
-	return refs, nil
+	return refs
 }
 
 // detectSystemd returns true if OS runs with systemd as init. When not sure
@@ -337,9 +420,10 @@ func (mounter *Mounter) GetDeviceNameFromMount(mountPath, pluginDir string) (str
 	return getDeviceNameFromMount(mounter, mountPath, pluginDir)
 }
 
-// getDeviceNameFromMount find the device name from /proc/mounts in which
-// the mount path reference should match the given plugin directory. In case no mount path reference
-// matches, returns the volume name taken from its given mountPath
+// getDeviceNameFromMount finds other mount points of the device backing
+// mountPath (keyed by majorMinor via GetMountRefs) whose path matches the
+// given plugin directory. In case no mount path reference matches, returns
+// the volume name taken from its given mountPath
 func getDeviceNameFromMount(mounter Interface, mountPath, pluginDir string) (string, error) {
 	refs, err := GetMountRefs(mounter, mountPath)
 	if err != nil {
@@ -520,15 +604,14 @@ func (mounter *SafeFormatAndMount) formatAndMount(source string, target string,
 			}
 
 			// Disk is unformatted so format it.
-			args := []string{source}
 			// Use 'ext4' as the default
 			if len(fstype) == 0 {
 				fstype = "ext4"
 			}
 
-			if fstype == "ext4" || fstype == "ext3" {
-				args = []string{"-F", source}
-			}
+			args := append([]string{}, mkfsDefaultArgs[fstype]...)
+			args = append(args, mounter.FormatOptions...)
+			args = append(args, source)
 			glog.Infof("Disk %q appears to be unformatted, attempting to format as type: %q with options: %v", source, fstype, args)
 			_, err := mounter.Exec.Run("mkfs."+fstype, args...)
 			if err == nil {
@@ -615,9 +698,9 @@ func isShared(path string, filename string) (bool, error) {
 
 	// process /proc/xxx/mountinfo in backward order and find the first mount
 	// point that is prefix of 'path' - that's the mount where path resides
-	var info *mountInfo
+	var info *MountInfo
 	for i := len(infos) - 1; i >= 0; i-- {
-		if strings.HasPrefix(path, infos[i].mountPoint) {
+		if strings.HasPrefix(path, infos[i].MountPoint) {
 			info = &infos[i]
 			break
 		}
@@ -626,29 +709,78 @@ func isShared(path string, filename string) (bool, error) {
 		return false, fmt.Errorf("cannot find mount point for %q", path)
 	}
 
-	// parse optional parameters
-	for _, opt := range info.optional {
-		if strings.HasPrefix(opt, "shared:") {
-			return true, nil
-		}
-	}
-	return false, nil
+	return info.Propagation.SharedPeerGroup != 0, nil
+}
+
+// MountInfo represents a single line in /proc/<pid>/mountinfo, as described
+// in https://www.kernel.org/doc/Documentation/filesystems/proc.txt.
+type MountInfo struct {
+	// ID is a unique identifier of the mount (may be reused after umount).
+	ID int
+	// ParentID is the ID of the parent mount (the ID of the root entry for
+	// the top-most mount, or its own ID).
+	ParentID int
+	// MajorMinor is the value of st_dev for files on this filesystem,
+	// formatted "major:minor". Unlike the Device field in MountPoint, this
+	// uniquely identifies the mounted filesystem instance, even when
+	// several mounts (e.g. repeated tmpfs mounts) report the same source.
+	MajorMinor string
+	// Root is the pathname, relative to the filesystem root, of the
+	// directory that forms the root of this mount.
+	Root string
+	// MountPoint is the pathname of the mount point, relative to the
+	// process's root.
+	MountPoint string
+	// MountOptions are the per-mount options, e.g. "rw,noatime".
+	MountOptions []string
+	// Propagation describes this mount's shared-subtree propagation type.
+	Propagation PropagationInfo
+	// FsType is the filesystem type, e.g. "ext4" or "tmpfs".
+	FsType string
+	// Source is the mount source reported by the kernel, e.g. a device
+	// path or "tmpfs".
+	Source string
+	// SuperOptions are the per-superblock (filesystem-wide) options.
+	SuperOptions []string
 }
 
-type mountInfo struct {
-	mountPoint string
-	// list of "optional parameters", mount propagation is one of them
-	optional []string
+// PropagationInfo holds a mount's shared-subtree propagation type and peer
+// group membership, parsed out of mountinfo's optional fields.
+type PropagationInfo struct {
+	// SharedPeerGroup is this mount's shared peer group ID, or 0 if the
+	// mount isn't shared.
+	SharedPeerGroup int
+	// MasterPeerGroup is the peer group ID this mount slaves to, or 0 if
+	// the mount isn't a slave.
+	MasterPeerGroup int
+	// UnbindablePeer is true if the mount is marked unbindable.
+	UnbindablePeer bool
+}
+
+// GetMountInfo parses /proc/self/mountinfo and returns the MountInfo entry
+// whose MountPoint is path.
+func GetMountInfo(path string) (*MountInfo, error) {
+	infos, err := parseMountInfo(procMountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	for i := range infos {
+		if infos[i].MountPoint == path {
+			return &infos[i], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find mount point for %q", path)
 }
 
-// parseMountInfo parses /proc/xxx/mountinfo.
-func parseMountInfo(filename string) ([]mountInfo, error) {
+// parseMountInfo parses /proc/xxx/mountinfo, as described in
+// https://www.kernel.org/doc/Documentation/filesystems/proc.txt.
+func parseMountInfo(filename string) ([]MountInfo, error) {
 	content, err := utilio.ConsistentRead(filename, maxListTries)
 	if err != nil {
-		return []mountInfo{}, err
+		return []MountInfo{}, err
 	}
 	contentStr := string(content)
-	infos := []mountInfo{}
+	infos := []MountInfo{}
 
 	for _, line := range strings.Split(contentStr, "\n") {
 		if line == "" {
@@ -656,16 +788,53 @@ func parseMountInfo(filename string) ([]mountInfo, error) {
 			continue
 		}
 		fields := strings.Fields(line)
-		if len(fields) < 7 {
-			return nil, fmt.Errorf("wrong number of fields in (expected %d, got %d): %s", 8, len(fields), line)
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("wrong number of fields in mountinfo line (expected at least %d, got %d): %s", 10, len(fields), line)
 		}
-		info := mountInfo{
-			mountPoint: fields[4],
-			optional:   []string{},
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mount ID in mountinfo line: %s", line)
+		}
+		parentID, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent ID in mountinfo line: %s", line)
 		}
-		for i := 6; i < len(fields) && fields[i] != "-"; i++ {
-			info.optional = append(info.optional, fields[i])
+		info := MountInfo{
+			ID:           id,
+			ParentID:     parentID,
+			MajorMinor:   fields[2],
+			Root:         fields[3],
+			MountPoint:   fields[4],
+			MountOptions: strings.Split(fields[5], ","),
 		}
+
+		// Optional fields, ending with the separator field "-".
+		i := 6
+		for ; i < len(fields) && fields[i] != "-"; i++ {
+			switch {
+			case strings.HasPrefix(fields[i], "shared:"):
+				group, err := strconv.Atoi(strings.TrimPrefix(fields[i], "shared:"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid shared peer group in mountinfo line: %s", line)
+				}
+				info.Propagation.SharedPeerGroup = group
+			case strings.HasPrefix(fields[i], "master:"):
+				group, err := strconv.Atoi(strings.TrimPrefix(fields[i], "master:"))
+				if err != nil {
+					return nil, fmt.Errorf("invalid master peer group in mountinfo line: %s", line)
+				}
+				info.Propagation.MasterPeerGroup = group
+			case fields[i] == "unbindable":
+				info.Propagation.UnbindablePeer = true
+			}
+		}
+		if i+3 >= len(fields) {
+			return nil, fmt.Errorf("missing fstype/source/super options in mountinfo line: %s", line)
+		}
+		info.FsType = fields[i+1]
+		info.Source = fields[i+2]
+		info.SuperOptions = strings.Split(fields[i+3], ",")
+
 		infos = append(infos, info)
 	}
 	return infos, nil
@@ -0,0 +1,199 @@
+// +build linux
+
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeMountInfo(t *testing.T, contents string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mountinfo")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "mountinfo")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestParseMountInfo(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  string
+		want      []MountInfo
+		wantError bool
+	}{
+		{
+			name: "two tmpfs mounts with the same source at different paths",
+			contents: "" +
+				"19 25 0:18 / /tmp/a rw,relatime shared:1 - tmpfs tmpfs rw\n" +
+				"20 25 0:19 / /tmp/b rw,relatime shared:2 - tmpfs tmpfs rw\n",
+			want: []MountInfo{
+				{
+					ID: 19, ParentID: 25, MajorMinor: "0:18", Root: "/", MountPoint: "/tmp/a",
+					MountOptions: []string{"rw", "relatime"},
+					Propagation:  PropagationInfo{SharedPeerGroup: 1},
+					FsType:       "tmpfs", Source: "tmpfs", SuperOptions: []string{"rw"},
+				},
+				{
+					ID: 20, ParentID: 25, MajorMinor: "0:19", Root: "/", MountPoint: "/tmp/b",
+					MountOptions: []string{"rw", "relatime"},
+					Propagation:  PropagationInfo{SharedPeerGroup: 2},
+					FsType:       "tmpfs", Source: "tmpfs", SuperOptions: []string{"rw"},
+				},
+			},
+		},
+		{
+			name:     "shared and master propagation",
+			contents: "19 25 8:1 / /var/lib/kubelet rw,relatime shared:1 master:2 - ext4 /dev/sda1 rw,errors=remount-ro\n",
+			want: []MountInfo{
+				{
+					ID: 19, ParentID: 25, MajorMinor: "8:1", Root: "/", MountPoint: "/var/lib/kubelet",
+					MountOptions: []string{"rw", "relatime"},
+					Propagation:  PropagationInfo{SharedPeerGroup: 1, MasterPeerGroup: 2},
+					FsType:       "ext4", Source: "/dev/sda1", SuperOptions: []string{"rw", "errors=remount-ro"},
+				},
+			},
+		},
+		{
+			name:      "too few fields",
+			contents:  "19 25 8:1 / /mnt rw,relatime\n",
+			wantError: true,
+		},
+		{
+			name:      "missing fstype/source/super options after the separator",
+			contents:  "19 25 8:1 / /mnt rw,relatime master:1 optional2 - ext4\n",
+			wantError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeMountInfo(t, test.contents)
+			got, err := parseMountInfo(path)
+			if test.wantError {
+				if err == nil {
+					t.Fatalf("parseMountInfo() expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMountInfo() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseMountInfo() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetMountRefsByMountInfo(t *testing.T) {
+	infos := []MountInfo{
+		{MajorMinor: "0:18", MountPoint: "/tmp/a"},
+		{MajorMinor: "0:19", MountPoint: "/tmp/b"},
+		{MajorMinor: "8:1", MountPoint: "/var/lib/kubelet/pods/1/volumes/vol"},
+		{MajorMinor: "8:1", MountPoint: "/var/lib/kubelet/pods/2/volumes/vol"},
+	}
+
+	tests := []struct {
+		name       string
+		mountPoint string
+		want       []string
+	}{
+		{
+			name:       "tmpfs mount shares no MajorMinor with the other tmpfs mount",
+			mountPoint: "/tmp/a",
+			want:       nil,
+		},
+		{
+			name:       "device bind-mounted into two pods",
+			mountPoint: "/var/lib/kubelet/pods/1/volumes/vol",
+			want:       []string{"/var/lib/kubelet/pods/2/volumes/vol"},
+		},
+		{
+			name:       "unknown mount point",
+			mountPoint: "/does/not/exist",
+			want:       nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := getMountRefsByMountInfo(infos, test.mountPoint, test.mountPoint)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("getMountRefsByMountInfo(%q) = %v, want %v", test.mountPoint, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBindRemountOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       BindOptions
+		wantOpts   []string
+		wantNeeded bool
+	}{
+		{
+			name:       "plain read-write bind",
+			opts:       BindOptions{},
+			wantOpts:   []string{"remount"},
+			wantNeeded: false,
+		},
+		{
+			name:       "read-only",
+			opts:       BindOptions{ReadOnly: true},
+			wantOpts:   []string{"remount", "ro"},
+			wantNeeded: true,
+		},
+		{
+			name:       "propagation only",
+			opts:       BindOptions{Propagation: "private"},
+			wantOpts:   []string{"remount", "private"},
+			wantNeeded: true,
+		},
+		{
+			name:       "read-only and propagation",
+			opts:       BindOptions{ReadOnly: true, Propagation: "private"},
+			wantOpts:   []string{"remount", "ro", "private"},
+			wantNeeded: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotOpts, gotNeeded := bindRemountOptions(test.opts)
+			if !reflect.DeepEqual(gotOpts, test.wantOpts) {
+				t.Errorf("bindRemountOptions(%+v) opts = %v, want %v", test.opts, gotOpts, test.wantOpts)
+			}
+			if gotNeeded != test.wantNeeded {
+				t.Errorf("bindRemountOptions(%+v) needed = %v, want %v", test.opts, gotNeeded, test.wantNeeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+// +build linux
+
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mount
+
+import (
+	"os/exec"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTranslateOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		flags   uintptr
+		data    string
+		ok      bool
+	}{
+		{
+			name:    "bind",
+			options: []string{"bind"},
+			flags:   unix.MS_BIND,
+			ok:      true,
+		},
+		{
+			name:    "rbind read-only",
+			options: []string{"rbind", "ro"},
+			flags:   unix.MS_BIND | unix.MS_REC | unix.MS_RDONLY,
+			ok:      true,
+		},
+		{
+			name:    "remount read-only",
+			options: []string{"remount", "ro"},
+			flags:   unix.MS_REMOUNT | unix.MS_RDONLY,
+			ok:      true,
+		},
+		{
+			name:    "flags and passthrough data",
+			options: []string{"noatime", "nosuid", "size=64m"},
+			flags:   unix.MS_NOATIME | unix.MS_NOSUID,
+			data:    "size=64m",
+			ok:      true,
+		},
+		{
+			name:    "needs a userspace helper",
+			options: []string{"user_xattr"},
+			ok:      false,
+		},
+		{
+			name:    "credentials file needs a helper",
+			options: []string{"cred=/etc/ceph/keyring"},
+			ok:      false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags, data, ok := translateOptions(test.options)
+			if ok != test.ok {
+				t.Fatalf("translateOptions(%v) ok = %v, want %v", test.options, ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+			if flags != test.flags {
+				t.Errorf("translateOptions(%v) flags = %#x, want %#x", test.options, flags, test.flags)
+			}
+			if data != test.data {
+				t.Errorf("translateOptions(%v) data = %q, want %q", test.options, data, test.data)
+			}
+		})
+	}
+}
+
+func TestNativeBindFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		flag    uintptr
+		isBind  bool
+	}{
+		{
+			name:    "bind",
+			options: []string{"bind"},
+			flag:    unix.MS_BIND,
+			isBind:  true,
+		},
+		{
+			name:    "rbind",
+			options: []string{"rbind"},
+			flag:    unix.MS_BIND | unix.MS_REC,
+			isBind:  true,
+		},
+		{
+			name:    "read-only bind",
+			options: []string{"bind", "ro"},
+			flag:    unix.MS_BIND,
+			isBind:  true,
+		},
+		{
+			name:    "not a bind",
+			options: []string{"noatime"},
+			isBind:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flag, isBind := nativeBindFlag(test.options)
+			if isBind != test.isBind {
+				t.Fatalf("nativeBindFlag(%v) isBind = %v, want %v", test.options, isBind, test.isBind)
+			}
+			if flag != test.flag {
+				t.Errorf("nativeBindFlag(%v) flag = %#x, want %#x", test.options, flag, test.flag)
+			}
+		})
+	}
+}
+
+func TestPropagationFlagMask(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         []string
+		wantPropagation uintptr
+		wantMountFlags  uintptr
+	}{
+		{
+			name:            "read-only only",
+			options:         []string{"ro"},
+			wantPropagation: 0,
+			wantMountFlags:  unix.MS_RDONLY,
+		},
+		{
+			name:            "private propagation only",
+			options:         []string{"private"},
+			wantPropagation: unix.MS_PRIVATE,
+			wantMountFlags:  0,
+		},
+		{
+			name:            "read-only and recursive-shared propagation",
+			options:         []string{"ro", "rshared"},
+			wantPropagation: unix.MS_SHARED | unix.MS_REC,
+			wantMountFlags:  unix.MS_RDONLY,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags, _, ok := translateOptions(test.options)
+			if !ok {
+				t.Fatalf("translateOptions(%v) = ok false, want true", test.options)
+			}
+			propagationFlags := flags & propagationFlagMask
+			mountFlags := flags &^ propagationFlagMask
+			if propagationFlags != test.wantPropagation {
+				t.Errorf("propagation flags for %v = %#x, want %#x", test.options, propagationFlags, test.wantPropagation)
+			}
+			if mountFlags != test.wantMountFlags {
+				t.Errorf("mount flags for %v = %#x, want %#x", test.options, mountFlags, test.wantMountFlags)
+			}
+		})
+	}
+}
+
+// BenchmarkMountExecPath approximates the cost the existing exec path pays
+// on every Mount call by spawning a trivial external process, since that
+// process-spawn overhead - not argument parsing - is what dominates.
+func BenchmarkMountExecPath(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if err := exec.Command("true").Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMountNativePath benchmarks the pure-Go option translation the
+// syscall fast path does instead, with no process spawned.
+func BenchmarkMountNativePath(b *testing.B) {
+	options := []string{"noatime", "nosuid", "nodev"}
+	for i := 0; i < b.N; i++ {
+		if _, _, ok := translateOptions(options); !ok {
+			b.Fatal("expected translation to succeed")
+		}
+	}
+}